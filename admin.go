@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// backendView is the JSON representation of a backend returned by the admin API.
+type backendView struct {
+	URL                 string  `json:"url"`
+	ID                  string  `json:"id"` // path segment for DELETE /backends/{id} and POST /backends/{id}/drain
+	Weight              int64   `json:"weight"`
+	Alive               bool    `json:"alive"`
+	Draining            bool    `json:"draining"`
+	ActiveConnections   int64   `json:"active_connections"`
+	PassiveFailureRatio float64 `json:"passive_failure_ratio"`
+	PassiveEjected      bool    `json:"passive_ejected"`
+}
+
+func newBackendView(b *Backend) backendView {
+	successes, failures := b.PassiveStats()
+	ratio := 0.0
+	if total := successes + failures; total > 0 {
+		ratio = failures / total
+	}
+	return backendView{
+		URL:                 b.URL.String(),
+		ID:                  backendID(b.URL.String()),
+		Weight:              b.Weight,
+		Alive:               b.IsAlive(),
+		Draining:            b.IsDraining(),
+		ActiveConnections:   b.GetActiveConnections(),
+		PassiveFailureRatio: ratio,
+		PassiveEjected:      b.passiveEjected(),
+	}
+}
+
+// backendID returns the path segment handleBackendItem expects to identify
+// the backend at backendUrl.
+func backendID(backendUrl string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(backendUrl))
+}
+
+// NewAdminMux builds the admin HTTP handler: a Prometheus /metrics endpoint
+// and a JSON API for live backend management. Backends created through the
+// API are probed using healthCfg, the same default used for backends that
+// don't override it on the command line.
+func NewAdminMux(pool *ServerPool, passiveCfg PassiveHealthConfig, healthCfg HealthCheckConfig) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, pool)
+	})
+
+	mux.HandleFunc("/backends", func(w http.ResponseWriter, r *http.Request) {
+		handleBackendsCollection(w, r, pool, passiveCfg, healthCfg)
+	})
+
+	mux.HandleFunc("/backends/", func(w http.ResponseWriter, r *http.Request) {
+		handleBackendItem(w, r, pool)
+	})
+
+	return mux
+}
+
+func handleBackendsCollection(w http.ResponseWriter, r *http.Request, pool *ServerPool, passiveCfg PassiveHealthConfig, healthCfg HealthCheckConfig) {
+	switch r.Method {
+	case http.MethodGet:
+		views := make([]backendView, 0)
+		for _, b := range pool.Backends() {
+			views = append(views, newBackendView(b))
+		}
+		writeJSON(w, http.StatusOK, views)
+
+	case http.MethodPost:
+		var req struct {
+			URL    string `json:"url"`
+			Weight int64  `json:"weight"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Weight <= 0 {
+			req.Weight = 1
+		}
+		serverUrl, err := url.Parse(req.URL)
+		if err != nil || serverUrl.Host == "" {
+			http.Error(w, "invalid backend url", http.StatusBadRequest)
+			return
+		}
+
+		backend := newBackend(serverUrl, req.Weight, passiveCfg, healthCfg)
+		pool.AddBackend(backend)
+		writeJSON(w, http.StatusCreated, newBackendView(backend))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleBackendItem serves DELETE /backends/{id} and POST /backends/{id}/drain,
+// where {id} is the backend's URL, base64url-encoded (RFC 4648 §5, no
+// padding) so it can occupy a single path segment: a raw or percent-encoded
+// URL contains "://", which net/http's ServeMux would otherwise collapse as
+// a double slash and 301-redirect before this handler ever ran.
+func handleBackendItem(w http.ResponseWriter, r *http.Request, pool *ServerPool) {
+	rest := strings.TrimPrefix(r.URL.Path, "/backends/")
+
+	drain := strings.HasSuffix(rest, "/drain")
+	if drain {
+		rest = strings.TrimSuffix(rest, "/drain")
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(rest)
+	backendUrl := string(decoded)
+	if err != nil || backendUrl == "" {
+		http.Error(w, "invalid backend id", http.StatusBadRequest)
+		return
+	}
+
+	if drain {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !pool.DrainBackend(backendUrl, true) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !pool.RemoveBackend(backendUrl) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testAdminMux(t *testing.T) (*http.ServeMux, *ServerPool) {
+	t.Helper()
+	pool := &ServerPool{strategy: &RoundRobinStrategy{}}
+	mux := NewAdminMux(pool, PassiveHealthConfig{FailRatio: 0.5, MinSamples: 10}, HealthCheckConfig{})
+	return mux, pool
+}
+
+func TestAdminAddBackend(t *testing.T) {
+	mux, pool := testAdminMux(t)
+
+	body, _ := json.Marshal(map[string]interface{}{"url": "http://a:8080", "weight": 2})
+	req := httptest.NewRequest(http.MethodPost, "/backends", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	backends := pool.Backends()
+	if len(backends) != 1 {
+		t.Fatalf("pool has %d backends, want 1", len(backends))
+	}
+	if backends[0].URL.String() != "http://a:8080" || backends[0].Weight != 2 {
+		t.Fatalf("added backend = %+v, want url http://a:8080 weight 2", backends[0])
+	}
+}
+
+func TestAdminAddBackendRejectsInvalidURL(t *testing.T) {
+	mux, _ := testAdminMux(t)
+
+	body, _ := json.Marshal(map[string]interface{}{"url": "::not a url"})
+	req := httptest.NewRequest(http.MethodPost, "/backends", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAdminRemoveBackend(t *testing.T) {
+	mux, pool := testAdminMux(t)
+	backend := testPersistenceBackend(t, "http://a:8080")
+	pool.AddBackend(backend)
+
+	req := httptest.NewRequest(http.MethodDelete, "/backends/"+backendID("http://a:8080"), nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusNoContent, rec.Body.String())
+	}
+	if len(pool.Backends()) != 0 {
+		t.Fatalf("pool has %d backends after delete, want 0", len(pool.Backends()))
+	}
+}
+
+func TestAdminRemoveBackendNotFound(t *testing.T) {
+	mux, _ := testAdminMux(t)
+
+	req := httptest.NewRequest(http.MethodDelete, "/backends/"+backendID("http://a:8080"), nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAdminDrainBackend(t *testing.T) {
+	mux, pool := testAdminMux(t)
+	backend := testPersistenceBackend(t, "http://a:8080")
+	pool.AddBackend(backend)
+
+	req := httptest.NewRequest(http.MethodPost, "/backends/"+backendID("http://a:8080")+"/drain", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, http.StatusNoContent, rec.Body.String())
+	}
+	if !backend.IsDraining() {
+		t.Fatal("backend not marked draining after POST .../drain")
+	}
+	if backend.Available() {
+		t.Fatal("draining backend should not be Available()")
+	}
+}
+
+func TestAdminListBackends(t *testing.T) {
+	mux, pool := testAdminMux(t)
+	pool.AddBackend(testPersistenceBackend(t, "http://a:8080"))
+	pool.AddBackend(testPersistenceBackend(t, "http://b:8080"))
+
+	req := httptest.NewRequest(http.MethodGet, "/backends", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var views []backendView
+	if err := json.Unmarshal(rec.Body.Bytes(), &views); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(views) != 2 {
+		t.Fatalf("got %d backends, want 2", len(views))
+	}
+}
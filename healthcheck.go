@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthState tracks the consecutive successes/failures a HealthChecker has
+// observed for a single backend, used to apply hysteresis before flipping
+// its alive status.
+type healthState struct {
+	mu              sync.Mutex
+	consecSuccesses int
+	consecFailures  int
+}
+
+// HealthCheckConfig configures how a HealthChecker probes a single backend.
+// If HTTPPath is empty, the backend is probed with a plain TCP dial (L4);
+// otherwise an HTTP GET is issued against HTTPPath and the response is
+// required to fall within [MinStatus, MaxStatus] (L7). Each backend carries
+// its own HealthCheckConfig, so one pool can mix L4-only and L7 backends
+// with different paths and status ranges.
+type HealthCheckConfig struct {
+	HTTPPath  string
+	MinStatus int
+	MaxStatus int
+}
+
+// HealthChecker actively probes every backend in a ServerPool on a fixed
+// interval and flips a backend's alive status once it has seen enough
+// consecutive successes or failures in a row, avoiding flapping on a single
+// bad probe.
+type HealthChecker struct {
+	pool      *ServerPool
+	interval  time.Duration
+	riseCount int // consecutive successes required to mark a dead backend alive
+	fallCount int // consecutive failures required to mark an alive backend dead
+
+	client *http.Client
+	states sync.Map // *Backend -> *healthState
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHealthChecker builds a HealthChecker for pool. Each backend is probed
+// according to its own HealthCheckConfig.
+func NewHealthChecker(pool *ServerPool, interval time.Duration, riseCount, fallCount int) *HealthChecker {
+	return &HealthChecker{
+		pool:      pool,
+		interval:  interval,
+		riseCount: riseCount,
+		fallCount: fallCount,
+		client:    &http.Client{Timeout: 2 * time.Second},
+	}
+}
+
+// Start begins probing every backend on the configured interval, in a
+// background goroutine, until Stop is called or ctx is canceled.
+func (h *HealthChecker) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.cancel = cancel
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.probeAll()
+
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.probeAll()
+			}
+		}
+	}()
+}
+
+// Stop cancels the background probing loop and waits for it to exit.
+func (h *HealthChecker) Stop() {
+	if h.cancel != nil {
+		h.cancel()
+	}
+	h.wg.Wait()
+}
+
+// probeAll probes every backend concurrently.
+func (h *HealthChecker) probeAll() {
+	var wg sync.WaitGroup
+	for _, b := range h.pool.Backends() {
+		b := b
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.probeOne(b)
+		}()
+	}
+	wg.Wait()
+}
+
+// probeOne runs a single probe against b and applies hysteresis before
+// updating its alive status.
+func (h *HealthChecker) probeOne(b *Backend) {
+	ok := h.probe(b)
+
+	stateIface, _ := h.states.LoadOrStore(b, &healthState{})
+	state := stateIface.(*healthState)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if ok {
+		state.consecSuccesses++
+		state.consecFailures = 0
+		if !b.IsAlive() && state.consecSuccesses >= h.riseCount && !b.passiveEjected() {
+			b.SetAlive(true)
+			log.Printf("[healthcheck] %s is back up after %d consecutive successful probes\n", b.URL, state.consecSuccesses)
+		}
+		return
+	}
+
+	state.consecFailures++
+	state.consecSuccesses = 0
+	if b.IsAlive() && state.consecFailures >= h.fallCount {
+		b.SetAlive(false)
+		log.Printf("[healthcheck] %s marked down after %d consecutive failed probes\n", b.URL, state.consecFailures)
+	}
+}
+
+// probe runs a single L4 or L7 check against b, per its own HealthCheckConfig.
+func (h *HealthChecker) probe(b *Backend) bool {
+	if b.healthCheck.HTTPPath == "" {
+		return isBackendAlive(b.URL)
+	}
+
+	u := *b.URL
+	u.Path = b.healthCheck.HTTPPath
+	resp, err := h.client.Get(u.String())
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode >= b.healthCheck.MinStatus && resp.StatusCode <= b.healthCheck.MaxStatus
+}
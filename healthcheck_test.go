@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, backends ...*Backend) *ServerPool {
+	t.Helper()
+	pool := &ServerPool{strategy: &RoundRobinStrategy{}}
+	for _, b := range backends {
+		pool.AddBackend(b)
+	}
+	return pool
+}
+
+func TestHealthCheckerFallRequiresConsecutiveFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	backend := &Backend{URL: u, Alive: true, healthCheck: HealthCheckConfig{HTTPPath: "/", MinStatus: 200, MaxStatus: 299}}
+	pool := newTestPool(t, backend)
+
+	checker := NewHealthChecker(pool, time.Hour, 2, 3)
+
+	checker.probeAll()
+	checker.probeAll()
+	if !backend.IsAlive() {
+		t.Fatal("backend marked dead before fallCount consecutive failures")
+	}
+
+	checker.probeAll()
+	if backend.IsAlive() {
+		t.Fatal("backend still alive after fallCount consecutive failures")
+	}
+}
+
+func TestHealthCheckerRiseRequiresConsecutiveSuccessesAndResetsOnFailure(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 1 {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	backend := &Backend{URL: u, Alive: false, healthCheck: HealthCheckConfig{HTTPPath: "/", MinStatus: 200, MaxStatus: 299}}
+	pool := newTestPool(t, backend)
+
+	checker := NewHealthChecker(pool, time.Hour, 2, 3)
+
+	atomic.StoreInt32(&healthy, 1)
+	checker.probeAll()
+	// A single intervening failure should reset the consecutive-success streak.
+	atomic.StoreInt32(&healthy, 0)
+	checker.probeAll()
+	atomic.StoreInt32(&healthy, 1)
+	checker.probeAll()
+	if backend.IsAlive() {
+		t.Fatal("backend marked alive after a failure reset its success streak")
+	}
+
+	checker.probeAll()
+	if !backend.IsAlive() {
+		t.Fatal("backend not marked alive after riseCount consecutive successes")
+	}
+}
+
+func TestHealthCheckerStartStop(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	backend := &Backend{URL: u, Alive: false, healthCheck: HealthCheckConfig{HTTPPath: "/", MinStatus: 200, MaxStatus: 299}}
+	pool := newTestPool(t, backend)
+
+	checker := NewHealthChecker(pool, 5*time.Millisecond, 1, 1)
+	checker.Start(context.Background())
+	defer checker.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if backend.IsAlive() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("backend never marked alive by background probing loop")
+}
@@ -0,0 +1,190 @@
+// Package l4 implements a raw TCP/TLS-passthrough load balancer, parallel to
+// the HTTP reverse proxy in package main but independent of its concrete
+// Backend/ServerPool types: callers supply a Picker that hands back a Target
+// for each new connection.
+package l4
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+)
+
+// proxyProtoV2Sig is the fixed 12-byte signature that opens every PROXY
+// protocol v2 header.
+var proxyProtoV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+// Target is a backend a Server can forward a connection to.
+type Target interface {
+	// Addr is the host:port to dial.
+	Addr() string
+	// MarkDown reports that a connection attempt to this target failed.
+	MarkDown()
+	// Acquire and Release bracket the lifetime of a proxied connection, for
+	// active-connection accounting.
+	Acquire()
+	Release()
+}
+
+// Picker chooses a Target for a new connection, or nil if none is available.
+type Picker interface {
+	Pick() Target
+}
+
+// Server accepts raw TCP connections and forwards bytes bidirectionally to a
+// Target chosen by its Picker. It never terminates TLS: an encrypted stream
+// is simply forwarded byte-for-byte, giving TLS passthrough for free.
+type Server struct {
+	picker        Picker
+	proxyProtocol string // "", "v1", or "v2"
+}
+
+// NewServer builds a Server that dispatches connections via picker. If
+// proxyProtocol is non-empty, a PROXY protocol header of that version is
+// written to the backend connection before any bytes are forwarded, so the
+// origin can recover the real client address.
+func NewServer(picker Picker, proxyProtocol string) *Server {
+	return &Server{picker: picker, proxyProtocol: proxyProtocol}
+}
+
+// ListenAndServe accepts connections on addr until it errors, handling each
+// one in its own goroutine.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	log.Printf("L4 load balancer started on %s\n", addr)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle proxies a single client connection to a chosen target until both
+// directions have finished.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	target := s.picker.Pick()
+	if target == nil {
+		log.Printf("[l4] %s: no backend available\n", conn.RemoteAddr())
+		return
+	}
+
+	upstream, err := net.Dial("tcp", target.Addr())
+	if err != nil {
+		log.Printf("[l4] %s: dial %s failed: %v\n", conn.RemoteAddr(), target.Addr(), err)
+		target.MarkDown()
+		return
+	}
+	defer upstream.Close()
+
+	if s.proxyProtocol != "" {
+		header, err := buildProxyProtocolHeader(s.proxyProtocol, conn.RemoteAddr(), upstream.LocalAddr())
+		if err != nil {
+			log.Printf("[l4] %s: building PROXY protocol header: %v\n", conn.RemoteAddr(), err)
+			return
+		}
+		if _, err := upstream.Write(header); err != nil {
+			log.Printf("[l4] %s: writing PROXY protocol header: %v\n", conn.RemoteAddr(), err)
+			return
+		}
+	}
+
+	target.Acquire()
+	defer target.Release()
+
+	done := make(chan struct{}, 2)
+	go pipe(upstream, conn, done)
+	go pipe(conn, upstream, done)
+	// Each direction only half-closes its destination on EOF, so a client
+	// that finishes sending before the backend finishes responding must not
+	// tear down the connection early: wait for both directions to finish.
+	<-done
+	<-done
+}
+
+// pipe copies from src to dst until src is exhausted or errors, then signals done.
+func pipe(dst, src net.Conn, done chan<- struct{}) {
+	_, _ = io.Copy(dst, src)
+	if tcp, ok := dst.(*net.TCPConn); ok {
+		_ = tcp.CloseWrite()
+	}
+	done <- struct{}{}
+}
+
+// buildProxyProtocolHeader builds a PROXY protocol v1 or v2 header naming
+// src as the client address and dst as the address the backend connection
+// was made from.
+func buildProxyProtocolHeader(version string, src, dst net.Addr) ([]byte, error) {
+	srcTCP, ok := src.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("source address %v is not TCP", src)
+	}
+	dstTCP, ok := dst.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("destination address %v is not TCP", dst)
+	}
+
+	switch version {
+	case "v1":
+		return buildProxyProtocolV1(srcTCP, dstTCP), nil
+	case "v2":
+		return buildProxyProtocolV2(srcTCP, dstTCP), nil
+	default:
+		return nil, fmt.Errorf("unknown PROXY protocol version %q", version)
+	}
+}
+
+func buildProxyProtocolV1(src, dst *net.TCPAddr) []byte {
+	family := "TCP4"
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP == nil || dstIP == nil {
+		family = "TCP6"
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, srcIP, dstIP, src.Port, dst.Port))
+}
+
+func buildProxyProtocolV2(src, dst *net.TCPAddr) []byte {
+	const (
+		verCmd     = 0x21 // version 2, command PROXY
+		famIPv4TCP = 0x11 // AF_INET << 4 | SOCK_STREAM
+		famIPv6TCP = 0x21 // AF_INET6 << 4 | SOCK_STREAM
+	)
+
+	var famProto byte
+	var addr []byte
+	if srcIP := src.IP.To4(); srcIP != nil {
+		famProto = famIPv4TCP
+		addr = make([]byte, 12)
+		copy(addr[0:4], srcIP)
+		copy(addr[4:8], dst.IP.To4())
+		binary.BigEndian.PutUint16(addr[8:10], uint16(src.Port))
+		binary.BigEndian.PutUint16(addr[10:12], uint16(dst.Port))
+	} else {
+		famProto = famIPv6TCP
+		addr = make([]byte, 36)
+		copy(addr[0:16], src.IP.To16())
+		copy(addr[16:32], dst.IP.To16())
+		binary.BigEndian.PutUint16(addr[32:34], uint16(src.Port))
+		binary.BigEndian.PutUint16(addr[34:36], uint16(dst.Port))
+	}
+
+	header := make([]byte, 0, len(proxyProtoV2Sig)+4+len(addr))
+	header = append(header, proxyProtoV2Sig...)
+	header = append(header, verCmd, famProto)
+	lenBuf := make([]byte, 2)
+	binary.BigEndian.PutUint16(lenBuf, uint16(len(addr)))
+	header = append(header, lenBuf...)
+	header = append(header, addr...)
+	return header
+}
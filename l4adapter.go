@@ -0,0 +1,35 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"pathnames/golang-load-balancer/l4"
+)
+
+// l4Target adapts a *Backend to l4.Target so the l4 package can forward
+// connections to it without importing package main's concrete types.
+type l4Target struct {
+	backend *Backend
+}
+
+func (t l4Target) Addr() string { return t.backend.URL.Host }
+
+func (t l4Target) MarkDown() { t.backend.SetAlive(false) }
+
+func (t l4Target) Acquire() { atomic.AddInt64(&t.backend.activeConns, 1) }
+
+func (t l4Target) Release() { atomic.AddInt64(&t.backend.activeConns, -1) }
+
+// l4Picker adapts a *ServerPool to l4.Picker, choosing a target the same way
+// the HTTP path does: via the pool's configured BalancingStrategy.
+type l4Picker struct {
+	pool *ServerPool
+}
+
+func (p l4Picker) Pick() l4.Target {
+	backend := p.pool.strategy.Pick(nil, p.pool.Backends())
+	if backend == nil {
+		return nil
+	}
+	return l4Target{backend: backend}
+}
@@ -8,11 +8,14 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
   "fmt"
+
+	"pathnames/golang-load-balancer/l4"
 )
 
 // Constants for tracking retries and attempts in request context
@@ -33,15 +36,111 @@ func GetAttemptsFromContext(r *http.Request) int {
 // Backend represents a single backend server
 type Backend struct {
 	URL          *url.URL                 // Backend URL
+	Weight       int64                    // Relative weight, used by the weighted round-robin strategy
 	Alive        bool                     // Is the backend alive?
 	mux          sync.RWMutex             // Protects concurrent access to Alive
 	ReverseProxy *httputil.ReverseProxy  // Reverse proxy to forward requests
+	activeConns  int64                    // atomic count of in-flight requests, used by the least-connections strategy
+	draining     int32                    // atomic bool: stop routing new requests here, let in-flight ones finish
+	retries      int64                    // atomic count of retries issued against this backend
+
+	// Active health check configuration for this backend; see healthcheck.go.
+	healthCheck HealthCheckConfig
+
+	// Passive (upstream-response-driven) health accounting; see passive.go.
+	passiveMu           sync.Mutex
+	passiveSuccesses    float64
+	passiveFailures     float64
+	passiveLastDecay    time.Time
+	passiveEjectedUntil time.Time
+
+	// Per-status-class request counts and upstream latency; see metrics.go.
+	statusCounts [len(statusClasses)]int64
+	latency      *latencyHistogram
+}
+
+// newBackend builds a Backend for serverUrl, wired with a reverse proxy,
+// retry/error handling, passive health accounting, and the active health
+// check config the HealthChecker should use to probe it. Used both at
+// startup and by the admin API when backends are added at runtime.
+func newBackend(serverUrl *url.URL, weight int64, passiveCfg PassiveHealthConfig, healthCfg HealthCheckConfig) *Backend {
+	proxy := httputil.NewSingleHostReverseProxy(serverUrl)
+
+	backend := &Backend{
+		URL:          serverUrl,
+		Weight:       weight,
+		Alive:        true,
+		ReverseProxy: proxy,
+		latency:      newLatencyHistogram(),
+		healthCheck:  healthCfg,
+	}
+
+	// Every upstream response also feeds the passive failure counter
+	proxy.ModifyResponse = wrapPassiveModifyResponse(backend, passiveCfg, nil)
+
+	// Set error handler to retry requests or mark backend as down
+	proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, e error) {
+		log.Printf("[%s] %s\n", serverUrl.Host, e.Error())
+		backend.recordPassiveResult(false, passiveCfg)
+
+		// Retry the same backend up to 3 times
+		retries := GetAttemptsFromContext(request)
+		if retries < 3 {
+			atomic.AddInt64(&backend.retries, 1)
+			atomic.AddInt64(&totalRetries, 1)
+			time.Sleep(10 * time.Millisecond)
+			ctx := context.WithValue(request.Context(), Retry, retries+1)
+			proxy.ServeHTTP(writer, request.WithContext(ctx))
+			return
+		}
+
+		// Mark backend as dead after retries
+		serverPool.MarkBackendStatus(serverUrl, false)
+
+		// Retry request on next available backend
+		attempts := GetAttemptsFromContext(request)
+		log.Printf("%s(%s) Attempting retry %d\n", request.RemoteAddr, request.URL.Path, attempts)
+		ctx := context.WithValue(request.Context(), Attempts, attempts+1)
+		lb(writer, request.WithContext(ctx))
+	}
+
+	return backend
+}
+
+// ServeHTTP forwards the request to the backend's reverse proxy, tracking the
+// number of in-flight requests, response status class, and upstream latency.
+func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&b.activeConns, 1)
+	defer atomic.AddInt64(&b.activeConns, -1)
+
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	b.ReverseProxy.ServeHTTP(rec, r)
+	b.recordRequestMetrics(rec.status, time.Since(start))
 }
 
-// ServerPool tracks all backends and the current index for round-robin
+// GetActiveConnections returns the backend's current number of in-flight requests.
+func (b *Backend) GetActiveConnections() int64 {
+	return atomic.LoadInt64(&b.activeConns)
+}
+
+// ServerPool tracks all backends and delegates peer selection to a BalancingStrategy,
+// optionally pinning repeat clients to the same backend via a Persistence mode
 type ServerPool struct {
-	backends []*Backend
-	current  uint64 // atomic counter for round-robin
+	mu          sync.RWMutex
+	backends    []*Backend
+	strategy    BalancingStrategy
+	persistence Persistence
+	generation  uint64 // bumped whenever the backend set changes, e.g. for SourceAddressAffinity's ring cache
+}
+
+// Generation returns a counter that increments every time a backend is
+// added to or removed from the pool, letting callers cache derived state
+// (such as a consistent-hash ring) until the set actually changes.
+func (s *ServerPool) Generation() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generation
 }
 
 // SetAlive updates the backend's alive status
@@ -58,31 +157,83 @@ func (b *Backend) IsAlive() bool {
 	return b.Alive
 }
 
-// NextIndex returns the next backend index in a round-robin fashion
-// Atomic increment ensures concurrent requests do not pick the same backend
-func (s *ServerPool) NextIndex() int {
-	return int(atomic.AddUint64(&s.current, 1) % uint64(len(s.backends)))
+// SetDraining marks the backend as draining (or un-draining): while draining,
+// it is skipped for new requests but in-flight ones are left to finish.
+func (b *Backend) SetDraining(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&b.draining, v)
+}
+
+// IsDraining reports whether the backend is currently draining.
+func (b *Backend) IsDraining() bool {
+	return atomic.LoadInt32(&b.draining) == 1
 }
 
-// GetNextPeer returns the next alive backend in round-robin order
-// Updates the current index if it chooses a different backend than expected
-func (s *ServerPool) GetNextPeer() *Backend {
-	nextIdx := s.NextIndex()
-	l := len(s.backends) + nextIdx // loop through all backends once
-	for i := nextIdx; i < l; i++ {
-		idx := i % len(s.backends)
-		if s.backends[idx].IsAlive() {
-			if i != nextIdx {
-				atomic.StoreUint64(&s.current, uint64(idx))
-			}
-			return s.backends[idx]
+// Available reports whether the backend should be considered for new
+// requests: alive and not draining.
+func (b *Backend) Available() bool {
+	return b.IsAlive() && !b.IsDraining()
+}
+
+// Backends returns a snapshot of the pool's current backends, safe to range
+// over even while AddBackend/RemoveBackend run concurrently.
+func (s *ServerPool) Backends() []*Backend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Backend, len(s.backends))
+	copy(out, s.backends)
+	return out
+}
+
+// AddBackend appends a new backend to the pool.
+func (s *ServerPool) AddBackend(b *Backend) {
+	s.mu.Lock()
+	s.backends = append(s.backends, b)
+	s.generation++
+	s.mu.Unlock()
+}
+
+// RemoveBackend removes the backend with the given URL from the pool,
+// reporting whether a matching backend was found.
+func (s *ServerPool) RemoveBackend(backendUrl string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, b := range s.backends {
+		if b.URL.String() == backendUrl {
+			s.backends = append(s.backends[:i], s.backends[i+1:]...)
+			s.generation++
+			return true
+		}
+	}
+	return false
+}
+
+// DrainBackend sets the draining flag on the backend with the given URL,
+// reporting whether a matching backend was found.
+func (s *ServerPool) DrainBackend(backendUrl string, draining bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, b := range s.backends {
+		if b.URL.String() == backendUrl {
+			b.SetDraining(draining)
+			return true
 		}
 	}
-	return nil
+	return false
+}
+
+// GetNextPeer returns the next available backend as chosen by the pool's BalancingStrategy
+func (s *ServerPool) GetNextPeer(r *http.Request) *Backend {
+	return s.strategy.Pick(r, s.Backends())
 }
 
 // MarkBackendStatus sets a backend's alive/dead status by URL
 func (s *ServerPool) MarkBackendStatus(backendUrl *url.URL, alive bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	for _, b := range s.backends {
 		if b.URL.String() == backendUrl.String() {
 			b.SetAlive(alive)
@@ -94,23 +245,37 @@ func (s *ServerPool) MarkBackendStatus(backendUrl *url.URL, alive bool) {
 // lb is the HTTP handler for the load balancer
 // It forwards requests to available backends or returns 503 if none are alive
 func lb(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt64(&totalRequests, 1)
 	attempts := GetAttemptsFromContext(r)
 
 	if attempts > 3 {
 		// Too many attempts, give up
 		log.Printf("%s(%s) Max attempts reached, terminating\n", r.RemoteAddr, r.URL.Path)
+		atomic.AddInt64(&total503, 1)
 		http.Error(w, "Service not available", http.StatusServiceUnavailable)
 		return
 	}
 
-	peer := serverPool.GetNextPeer()
+	backends := serverPool.Backends()
+
+	var peer *Backend
+	if serverPool.persistence != nil {
+		peer = serverPool.persistence.Pick(r, backends)
+	}
+	if peer == nil {
+		peer = serverPool.strategy.Pick(r, backends)
+	}
 	if peer != nil {
+		if serverPool.persistence != nil {
+			serverPool.persistence.Apply(w, r, peer)
+		}
 		// Forward request to chosen backend
-		peer.ReverseProxy.ServeHTTP(w, r)
+		peer.ServeHTTP(w, r)
 		return
 	}
 
 	// No backends available
+	atomic.AddInt64(&total503, 1)
 	http.Error(w, "Service not available", http.StatusServiceUnavailable)
 }
 
@@ -133,68 +298,174 @@ func isBackendAlive(u *url.URL) bool {
 	return true
 }
 
+// parseStatusRange parses a "min-max" HTTP status code range, as accepted by
+// the -healthcheck-http-status-range flag.
+func parseStatusRange(s string) (min int, max int, err error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected format \"min-max\", got %q", s)
+	}
+	min, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return min, max, nil
+}
+
 
 var serverPool ServerPool
 
+// Global counters surfaced on the admin /metrics endpoint; see metrics.go.
+var (
+	totalRequests int64
+	totalRetries  int64
+	total503      int64
+)
+
 func main() {
 	// Command-line flags for backends and port
 	var serverList string
 	var port int
-	flag.StringVar(&serverList, "backends", "", "Comma-separated list of backends")
+	var adminAddr string
+	var mode string
+	var l4ProxyProtocol string
+	var strategyName string
+	var healthCheckInterval time.Duration
+	var healthCheckRise int
+	var healthCheckFall int
+	var healthCheckHTTPPath string
+	var healthCheckHTTPStatusRange string
+	flag.StringVar(&serverList, "backends", "", "Comma-separated list of backends, each optionally suffixed with |<weight>|<health-path>|<health-status-range>; trailing fields may be left empty to fall back to the -healthcheck-* flags")
 	flag.IntVar(&port, "port", 8080, "Port to serve")
+	flag.StringVar(&adminAddr, "admin-addr", "", "If set, serve Prometheus metrics and the JSON admin API on this address (e.g. :9000)")
+	flag.StringVar(&mode, "mode", "http", "Load balancer mode: http (L7 reverse proxy) or l4 (raw TCP/TLS-passthrough proxy)")
+	flag.StringVar(&l4ProxyProtocol, "l4-proxy-protocol", "", "In l4 mode, PROXY protocol header to emit toward backends: \"\" (none), v1, or v2")
+	flag.StringVar(&strategyName, "strategy", "round-robin", "Balancing strategy: round-robin, weighted-round-robin, or least-connections")
+	flag.DurationVar(&healthCheckInterval, "healthcheck-interval", 10*time.Second, "Interval between active health check probes")
+	flag.IntVar(&healthCheckRise, "healthcheck-rise", 2, "Consecutive successful probes required to mark a dead backend alive")
+	flag.IntVar(&healthCheckFall, "healthcheck-fall", 3, "Consecutive failed probes required to mark an alive backend dead")
+	flag.StringVar(&healthCheckHTTPPath, "healthcheck-http-path", "", "If set, probe this path over HTTP (L7) instead of a plain TCP dial (L4)")
+	flag.StringVar(&healthCheckHTTPStatusRange, "healthcheck-http-status-range", "200-399", "Accepted \"min-max\" status code range for HTTP health checks")
+	var persistenceMode string
+	var trustXFF bool
+	var affinitySecret string
+	flag.StringVar(&persistenceMode, "persistence", "none", "Session persistence: none, source-ip, or cookie")
+	flag.BoolVar(&trustXFF, "trust-xff", false, "For source-ip persistence, hash the leftmost X-Forwarded-For address instead of RemoteAddr")
+	flag.StringVar(&affinitySecret, "affinity-secret", "", "Secret used to sign LB_AFFINITY cookies under cookie persistence (required when -persistence=cookie)")
+	var passiveFailRatio float64
+	var passiveMinSamples float64
+	var passiveCooldown time.Duration
+	flag.Float64Var(&passiveFailRatio, "passive-fail-ratio", 0.5, "Decayed failure ratio at/above which a backend is passively ejected")
+	flag.Float64Var(&passiveMinSamples, "passive-min-samples", 10, "Minimum decayed sample count before the passive failure ratio is trusted")
+	flag.DurationVar(&passiveCooldown, "passive-cooldown", 30*time.Second, "How long a passively ejected backend is excluded before it's eligible for re-admission")
 	flag.Parse()
 
+	passiveCfg := PassiveHealthConfig{
+		FailRatio:  passiveFailRatio,
+		MinSamples: passiveMinSamples,
+		Cooldown:   passiveCooldown,
+	}
+
 	// Require at least one backend
 	if len(serverList) == 0 {
 		log.Fatal("Please provide a minimum of one backend server.")
 	}
 
+	switch strategyName {
+	case "round-robin":
+		serverPool.strategy = &RoundRobinStrategy{}
+	case "weighted-round-robin":
+		serverPool.strategy = NewWeightedRoundRobinStrategy()
+	case "least-connections":
+		serverPool.strategy = &LeastConnectionsStrategy{}
+	default:
+		log.Fatalf("Unknown strategy: %s", strategyName)
+	}
+
+	defaultMinStatus, defaultMaxStatus, err := parseStatusRange(healthCheckHTTPStatusRange)
+	if err != nil {
+		log.Fatalf("Invalid -healthcheck-http-status-range: %v", err)
+	}
+
 	// Split backends and create ReverseProxy for each
 	tokens := strings.Split(serverList, ",")
 	for _, tok := range tokens {
-		serverUrl, err := url.Parse(tok)
-		if err != nil {
-			log.Fatal(err) // Exit if URL is invalid
-		}
-
-		// Create reverse proxy for backend
-		proxy := httputil.NewSingleHostReverseProxy(serverUrl)
+		// Backends may carry up to three "|"-separated suffixes: weight,
+		// an override health check path, and an override health status
+		// range. Any of them may be left empty to fall back to the
+		// corresponding -healthcheck-* flag.
+		fields := strings.Split(tok, "|")
+		addr := fields[0]
 
-		// Set error handler to retry requests or mark backend as down
-		proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, e error) {
-			log.Printf("[%s] %s\n", serverUrl.Host, e.Error())
+		var weight int64 = 1
+		if len(fields) > 1 && fields[1] != "" {
+			w, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil || w <= 0 {
+				log.Fatalf("Invalid weight in backend %q: %v", tok, err)
+			}
+			weight = w
+		}
 
-			// Retry the same backend up to 3 times
-			retries := GetAttemptsFromContext(request)
-			if retries < 3 {
-				time.Sleep(10 * time.Millisecond)
-				ctx := context.WithValue(request.Context(), Retry, retries+1)
-				proxy.ServeHTTP(writer, request.WithContext(ctx))
-				return
+		healthCfg := HealthCheckConfig{HTTPPath: healthCheckHTTPPath, MinStatus: defaultMinStatus, MaxStatus: defaultMaxStatus}
+		if len(fields) > 2 && fields[2] != "" {
+			healthCfg.HTTPPath = fields[2]
+		}
+		if len(fields) > 3 && fields[3] != "" {
+			min, max, err := parseStatusRange(fields[3])
+			if err != nil {
+				log.Fatalf("Invalid health status range in backend %q: %v", tok, err)
 			}
+			healthCfg.MinStatus, healthCfg.MaxStatus = min, max
+		}
 
-			// Mark backend as dead after retries
-			serverPool.MarkBackendStatus(serverUrl, false)
+		serverUrl, err := url.Parse(addr)
+		if err != nil {
+			log.Fatal(err) // Exit if URL is invalid
+		}
 
-			// Retry request on next available backend
-			attempts := GetAttemptsFromContext(request)
-			log.Printf("%s(%s) Attempting retry %d\n", request.RemoteAddr, request.URL.Path, attempts)
-			ctx := context.WithValue(request.Context(), Attempts, attempts+1)
-			lb(writer, request.WithContext(ctx))
+		serverPool.AddBackend(newBackend(serverUrl, weight, passiveCfg, healthCfg))
+		log.Printf("Added backend: %s (weight %d, health check %q)\n", serverUrl, weight, healthCfg.HTTPPath)
+	}
+
+	switch persistenceMode {
+	case "none":
+		// no persistence layer; the strategy alone decides
+	case "source-ip":
+		serverPool.persistence = NewSourceAddressAffinity(&serverPool, trustXFF)
+	case "cookie":
+		if affinitySecret == "" {
+			log.Fatal("Please provide -affinity-secret when using -persistence=cookie")
 		}
+		serverPool.persistence = NewCookiePersistence([]byte(affinitySecret), serverPool.strategy)
+	default:
+		log.Fatalf("Unknown persistence mode: %s", persistenceMode)
+	}
 
-		// Add backend to pool
-		serverPool.backends = append(serverPool.backends, &Backend{
-			URL:          serverUrl,
-			Alive:        true,
-			ReverseProxy: proxy,
-		})
+	checker := NewHealthChecker(&serverPool, healthCheckInterval, healthCheckRise, healthCheckFall)
+	checker.Start(context.Background())
 
-		log.Printf("Added backend: %s\n", serverUrl)
+	defaultHealthCfg := HealthCheckConfig{HTTPPath: healthCheckHTTPPath, MinStatus: defaultMinStatus, MaxStatus: defaultMaxStatus}
+	if adminAddr != "" {
+		go func() {
+			log.Printf("Admin API and metrics listening on %s\n", adminAddr)
+			log.Fatal(http.ListenAndServe(adminAddr, NewAdminMux(&serverPool, passiveCfg, defaultHealthCfg)))
+		}()
 	}
 
-	// Start the HTTP load balancer server
-	http.HandleFunc("/", lb)
-	log.Printf("Load balancer started on port %d\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	switch mode {
+	case "http":
+		// Start the HTTP load balancer server
+		http.HandleFunc("/", lb)
+		log.Printf("Load balancer started on port %d\n", port)
+		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	case "l4":
+		l4Server := l4.NewServer(l4Picker{pool: &serverPool}, l4ProxyProtocol)
+		log.Fatal(l4Server.ListenAndServe(fmt.Sprintf(":%d", port)))
+	default:
+		log.Fatalf("Unknown mode: %s", mode)
+	}
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// statusClasses are the response status buckets tracked per backend.
+var statusClasses = [...]string{"2xx", "3xx", "4xx", "5xx", "other"}
+
+// statusClassIndex returns the statusClasses index for an HTTP status code.
+func statusClassIndex(status int) int {
+	switch {
+	case status >= 200 && status < 300:
+		return 0
+	case status >= 300 && status < 400:
+		return 1
+	case status >= 400 && status < 500:
+		return 2
+	case status >= 500 && status < 600:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// statusRecorder wraps an http.ResponseWriter to capture the status code a
+// handler wrote, defaulting to 200 if WriteHeader is never called explicitly.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// recordRequestMetrics updates b's per-status-class counters and upstream
+// latency histogram for a completed request.
+func (b *Backend) recordRequestMetrics(status int, elapsed time.Duration) {
+	atomic.AddInt64(&b.statusCounts[statusClassIndex(status)], 1)
+	b.latency.observe(elapsed.Seconds())
+}
+
+// StatusCounts returns the backend's request counts keyed by status class
+// ("2xx", "3xx", "4xx", "5xx", "other").
+func (b *Backend) StatusCounts() map[string]int64 {
+	counts := make(map[string]int64, len(statusClasses))
+	for i, class := range statusClasses {
+		counts[class] = atomic.LoadInt64(&b.statusCounts[i])
+	}
+	return counts
+}
+
+// Retries returns the number of retries issued against this backend.
+func (b *Backend) Retries() int64 {
+	return atomic.LoadInt64(&b.retries)
+}
+
+// latencyHistogram is a minimal fixed-bucket Prometheus-style histogram,
+// hand-rolled since this binary has no third-party dependencies.
+type latencyHistogram struct {
+	buckets []float64 // upper bounds in seconds, ascending
+
+	mu     sync.Mutex
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// newLatencyHistogram returns a histogram with a default set of second-scale
+// buckets suitable for upstream HTTP latency.
+func newLatencyHistogram() *latencyHistogram {
+	buckets := []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	return &latencyHistogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+// observe records a single latency sample, in seconds.
+func (h *latencyHistogram) observe(seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += seconds
+	h.count++
+	for i, upperBound := range h.buckets {
+		if seconds <= upperBound {
+			h.counts[i]++
+		}
+	}
+}
+
+// writePrometheus writes the histogram's buckets, sum, and count in
+// Prometheus text exposition format for the given backend label.
+func (h *latencyHistogram) writePrometheus(w http.ResponseWriter, backend string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upperBound := range h.buckets {
+		fmt.Fprintf(w, "backend_request_duration_seconds_bucket{backend=%q,le=%q} %d\n", backend, formatFloat(upperBound), h.counts[i])
+	}
+	fmt.Fprintf(w, "backend_request_duration_seconds_bucket{backend=%q,le=\"+Inf\"} %d\n", backend, h.count)
+	fmt.Fprintf(w, "backend_request_duration_seconds_sum{backend=%q} %s\n", backend, formatFloat(h.sum))
+	fmt.Fprintf(w, "backend_request_duration_seconds_count{backend=%q} %d\n", backend, h.count)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func boolToGauge(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeMetrics renders pool's counters in Prometheus text exposition format.
+func writeMetrics(w http.ResponseWriter, pool *ServerPool) {
+	fmt.Fprintf(w, "# HELP lb_requests_total Total requests handled by the load balancer.\n")
+	fmt.Fprintf(w, "# TYPE lb_requests_total counter\n")
+	fmt.Fprintf(w, "lb_requests_total %d\n", atomic.LoadInt64(&totalRequests))
+
+	fmt.Fprintf(w, "# HELP lb_retries_total Total retries issued by the load balancer.\n")
+	fmt.Fprintf(w, "# TYPE lb_retries_total counter\n")
+	fmt.Fprintf(w, "lb_retries_total %d\n", atomic.LoadInt64(&totalRetries))
+
+	fmt.Fprintf(w, "# HELP lb_service_unavailable_total Requests rejected with 503 because no backend was available.\n")
+	fmt.Fprintf(w, "# TYPE lb_service_unavailable_total counter\n")
+	fmt.Fprintf(w, "lb_service_unavailable_total %d\n", atomic.LoadInt64(&total503))
+
+	backends := pool.Backends()
+
+	fmt.Fprintf(w, "# HELP backend_up Whether the backend is currently alive (1) or dead (0).\n")
+	fmt.Fprintf(w, "# TYPE backend_up gauge\n")
+	for _, b := range backends {
+		fmt.Fprintf(w, "backend_up{backend=%q} %d\n", b.URL.String(), boolToGauge(b.IsAlive()))
+	}
+
+	fmt.Fprintf(w, "# HELP backend_active_connections In-flight requests currently being proxied to the backend.\n")
+	fmt.Fprintf(w, "# TYPE backend_active_connections gauge\n")
+	for _, b := range backends {
+		fmt.Fprintf(w, "backend_active_connections{backend=%q} %d\n", b.URL.String(), b.GetActiveConnections())
+	}
+
+	fmt.Fprintf(w, "# HELP backend_requests_total Requests proxied to the backend, by response status class.\n")
+	fmt.Fprintf(w, "# TYPE backend_requests_total counter\n")
+	for _, b := range backends {
+		for _, class := range statusClasses {
+			fmt.Fprintf(w, "backend_requests_total{backend=%q,status=%q} %d\n", b.URL.String(), class, b.StatusCounts()[class])
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP backend_retries_total Retries issued against the backend.\n")
+	fmt.Fprintf(w, "# TYPE backend_retries_total counter\n")
+	for _, b := range backends {
+		fmt.Fprintf(w, "backend_retries_total{backend=%q} %d\n", b.URL.String(), b.Retries())
+	}
+
+	fmt.Fprintf(w, "# HELP backend_request_duration_seconds Upstream latency observed proxying to the backend.\n")
+	fmt.Fprintf(w, "# TYPE backend_request_duration_seconds histogram\n")
+	for _, b := range backends {
+		b.latency.writePrometheus(w, b.URL.String())
+	}
+
+	fmt.Fprintf(w, "# HELP backend_passive_failure_ratio Decayed passive failure ratio (failures / (successes + failures)).\n")
+	fmt.Fprintf(w, "# TYPE backend_passive_failure_ratio gauge\n")
+	for _, b := range backends {
+		successes, failures := b.PassiveStats()
+		ratio := 0.0
+		if total := successes + failures; total > 0 {
+			ratio = failures / total
+		}
+		fmt.Fprintf(w, "backend_passive_failure_ratio{backend=%q} %s\n", b.URL.String(), formatFloat(ratio))
+	}
+
+	fmt.Fprintf(w, "# HELP backend_passive_ejected Whether the backend is currently ejected by passive health checking (1) or not (0).\n")
+	fmt.Fprintf(w, "# TYPE backend_passive_ejected gauge\n")
+	for _, b := range backends {
+		fmt.Fprintf(w, "backend_passive_ejected{backend=%q} %d\n", b.URL.String(), boolToGauge(b.passiveEjected()))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// passiveDecayHalfLife is the half-life of the exponential decay applied to
+// a backend's passive success/failure counters, approximating a rolling
+// ~30s window without having to retain individual samples.
+const passiveDecayHalfLife = 15 * time.Second
+
+// PassiveHealthConfig configures passive (upstream-response-driven) ejection.
+type PassiveHealthConfig struct {
+	FailRatio  float64       // failure ratio at/above which a backend is ejected
+	MinSamples float64       // minimum decayed sample count before the ratio is trusted
+	Cooldown   time.Duration // how long a backend stays ejected before it's eligible for re-admission
+}
+
+// recordPassiveResult feeds a single upstream outcome into b's decayed
+// failure counter and ejects b, for cfg.Cooldown, if the failure ratio
+// crosses cfg.FailRatio once enough samples have been seen.
+func (b *Backend) recordPassiveResult(success bool, cfg PassiveHealthConfig) {
+	now := time.Now()
+
+	b.passiveMu.Lock()
+	defer b.passiveMu.Unlock()
+
+	if !b.passiveLastDecay.IsZero() {
+		if elapsed := now.Sub(b.passiveLastDecay); elapsed > 0 {
+			factor := math.Pow(0.5, elapsed.Seconds()/passiveDecayHalfLife.Seconds())
+			b.passiveSuccesses *= factor
+			b.passiveFailures *= factor
+		}
+	}
+	b.passiveLastDecay = now
+
+	if success {
+		b.passiveSuccesses++
+	} else {
+		b.passiveFailures++
+	}
+
+	total := b.passiveSuccesses + b.passiveFailures
+	if success || total < cfg.MinSamples {
+		return
+	}
+
+	ratio := b.passiveFailures / total
+	if ratio < cfg.FailRatio {
+		return
+	}
+	if now.Before(b.passiveEjectedUntil) {
+		return // already ejected
+	}
+
+	b.passiveEjectedUntil = now.Add(cfg.Cooldown)
+	if b.IsAlive() {
+		b.SetAlive(false)
+		log.Printf("[passive] %s ejected for %s: failure ratio %.2f over %.1f samples\n", b.URL, cfg.Cooldown, ratio, total)
+	}
+}
+
+// passiveEjected reports whether b is still serving out a passive ejection
+// cooldown, which HealthChecker consults before re-admitting a backend on
+// the strength of active probes alone.
+func (b *Backend) passiveEjected() bool {
+	b.passiveMu.Lock()
+	defer b.passiveMu.Unlock()
+	return time.Now().Before(b.passiveEjectedUntil)
+}
+
+// PassiveStats reports b's current decayed success/failure counts, for the
+// metrics endpoint.
+func (b *Backend) PassiveStats() (successes, failures float64) {
+	b.passiveMu.Lock()
+	defer b.passiveMu.Unlock()
+	return b.passiveSuccesses, b.passiveFailures
+}
+
+// wrapPassiveModifyResponse wraps an httputil.ReverseProxy's ModifyResponse
+// hook (if any) so that every upstream response also feeds b's passive
+// failure counter: 2xx/3xx count as successes, 5xx counts as a failure.
+// 4xx reflects client request quality, not backend health, so it counts as
+// neither and is left out of the ratio entirely.
+func wrapPassiveModifyResponse(b *Backend, cfg PassiveHealthConfig, next func(*http.Response) error) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		switch {
+		case resp.StatusCode < 400:
+			b.recordPassiveResult(true, cfg)
+		case resp.StatusCode >= 500:
+			b.recordPassiveResult(false, cfg)
+		}
+		if next != nil {
+			return next(resp)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func testPassiveBackend(t *testing.T) *Backend {
+	t.Helper()
+	u, err := url.Parse("http://a:8080")
+	if err != nil {
+		t.Fatalf("parsing url: %v", err)
+	}
+	return &Backend{URL: u, Alive: true}
+}
+
+func TestRecordPassiveResultEjectsAfterFailureRatioCrossesThreshold(t *testing.T) {
+	backend := testPassiveBackend(t)
+	cfg := PassiveHealthConfig{FailRatio: 0.5, MinSamples: 3, Cooldown: time.Minute}
+
+	// Below MinSamples: even all failures shouldn't eject yet.
+	backend.recordPassiveResult(false, cfg)
+	backend.recordPassiveResult(false, cfg)
+	if !backend.IsAlive() {
+		t.Fatal("backend ejected before MinSamples was reached")
+	}
+
+	// Comfortably past MinSamples, still all failures.
+	backend.recordPassiveResult(false, cfg)
+	backend.recordPassiveResult(false, cfg)
+	backend.recordPassiveResult(false, cfg)
+	if backend.IsAlive() {
+		t.Fatal("backend not ejected once the failure ratio crossed FailRatio with enough samples")
+	}
+	if !backend.passiveEjected() {
+		t.Fatal("passiveEjected() false immediately after ejection")
+	}
+}
+
+func TestRecordPassiveResultDoesNotEjectBelowFailRatio(t *testing.T) {
+	backend := testPassiveBackend(t)
+	cfg := PassiveHealthConfig{FailRatio: 0.5, MinSamples: 4, Cooldown: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		backend.recordPassiveResult(true, cfg)
+	}
+	backend.recordPassiveResult(false, cfg)
+
+	if !backend.IsAlive() {
+		t.Fatal("backend ejected despite a failure ratio below FailRatio")
+	}
+}
+
+func TestRecordPassiveResultDecaysOldSamplesOverTime(t *testing.T) {
+	backend := testPassiveBackend(t)
+	cfg := PassiveHealthConfig{FailRatio: 0.5, MinSamples: 2, Cooldown: time.Minute}
+
+	backend.recordPassiveResult(false, cfg)
+	backend.recordPassiveResult(false, cfg)
+
+	// Force the next sample's decay to treat the prior failures as ancient,
+	// as if several half-lives had elapsed, without sleeping in the test.
+	backend.passiveMu.Lock()
+	backend.passiveLastDecay = time.Now().Add(-10 * passiveDecayHalfLife)
+	backend.passiveMu.Unlock()
+
+	successesBefore, failuresBefore := backend.PassiveStats()
+	if failuresBefore < 1.9 {
+		t.Fatalf("failures = %v before decay, want ~2", failuresBefore)
+	}
+
+	backend.recordPassiveResult(true, cfg)
+	successesAfter, failuresAfter := backend.PassiveStats()
+	if failuresAfter >= failuresBefore {
+		t.Fatalf("failures = %v after a long gap, want it decayed below %v", failuresAfter, failuresBefore)
+	}
+	if successesAfter <= successesBefore {
+		t.Fatalf("successes = %v after recording a success, want it to have increased", successesAfter)
+	}
+}
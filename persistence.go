@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// affinityCookieName is the cookie used by CookiePersistence to pin a client
+// to the backend that served its first request.
+const affinityCookieName = "LB_AFFINITY"
+
+// Persistence pins repeat clients to the same backend on top of whatever
+// BalancingStrategy the pool is using. Pick is consulted before the
+// strategy; Apply lets the persistence mode annotate the response once a
+// backend has actually been chosen (e.g. to set a sticky cookie).
+type Persistence interface {
+	Pick(r *http.Request, backends []*Backend) *Backend
+	Apply(w http.ResponseWriter, r *http.Request, chosen *Backend)
+}
+
+// hashRing implements consistent hashing over a set of backends so that
+// adding or removing a backend only remaps a small fraction of keys.
+type hashRing struct {
+	replicas int
+
+	mu    sync.RWMutex
+	keys  []uint32
+	nodes map[uint32]*Backend
+}
+
+// newHashRing returns an empty ring using replicas virtual nodes per backend.
+func newHashRing(replicas int) *hashRing {
+	return &hashRing{replicas: replicas, nodes: make(map[uint32]*Backend)}
+}
+
+// set rebuilds the ring from scratch for the given backends.
+func (h *hashRing) set(backends []*Backend) {
+	keys := make([]uint32, 0, len(backends)*h.replicas)
+	nodes := make(map[uint32]*Backend, len(backends)*h.replicas)
+
+	for _, b := range backends {
+		for i := 0; i < h.replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(b.URL.String() + "#" + strconv.Itoa(i)))
+			keys = append(keys, hash)
+			nodes[hash] = b
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	h.mu.Lock()
+	h.keys = keys
+	h.nodes = nodes
+	h.mu.Unlock()
+}
+
+// get walks the ring clockwise from key's hash and returns the first backend
+// for which alive returns true.
+func (h *hashRing) get(key string, alive func(*Backend) bool) *Backend {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.keys) == 0 {
+		return nil
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(h.keys), func(i int) bool { return h.keys[i] >= hash })
+
+	for i := 0; i < len(h.keys); i++ {
+		node := h.nodes[h.keys[(start+i)%len(h.keys)]]
+		if alive(node) {
+			return node
+		}
+	}
+	return nil
+}
+
+// SourceAddressAffinity pins a client to a backend by hashing its source IP
+// into a consistent-hash ring of alive backends. The ring is rebuilt
+// whenever the pool's backend set changes (tracked via ServerPool's
+// generation counter), so backends added or removed through the admin API
+// are reflected without remapping every other client.
+type SourceAddressAffinity struct {
+	pool     *ServerPool
+	trustXFF bool
+
+	mu       sync.Mutex
+	ring     *hashRing
+	builtGen uint64
+}
+
+// NewSourceAddressAffinity builds a source-IP affinity persistence mode over
+// pool's backends. When trustXFF is set, the leftmost address in a request's
+// X-Forwarded-For header is hashed instead of RemoteAddr.
+func NewSourceAddressAffinity(pool *ServerPool, trustXFF bool) *SourceAddressAffinity {
+	return &SourceAddressAffinity{pool: pool, trustXFF: trustXFF}
+}
+
+// Pick returns the alive backend whose ring position is closest to the
+// client's source IP.
+func (s *SourceAddressAffinity) Pick(r *http.Request, backends []*Backend) *Backend {
+	return s.ringFor(backends).get(clientIP(r, s.trustXFF), (*Backend).Available)
+}
+
+// ringFor returns a ring reflecting the pool's current backend set,
+// rebuilding it only when the pool has changed since the last Pick.
+func (s *SourceAddressAffinity) ringFor(backends []*Backend) *hashRing {
+	gen := s.pool.Generation()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ring == nil || s.builtGen != gen {
+		ring := newHashRing(160)
+		ring.set(backends)
+		s.ring = ring
+		s.builtGen = gen
+	}
+	return s.ring
+}
+
+// Apply is a no-op: source-IP affinity needs no response-side bookkeeping.
+func (s *SourceAddressAffinity) Apply(w http.ResponseWriter, r *http.Request, chosen *Backend) {}
+
+// clientIP returns the request's source IP with any port stripped. When
+// trustXFF is set and an X-Forwarded-For header is present, its leftmost
+// (original client) address is used instead of RemoteAddr.
+func clientIP(r *http.Request, trustXFF bool) string {
+	if trustXFF {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			return strings.TrimSpace(strings.Split(xff, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// CookiePersistence pins a client to a backend via a signed LB_AFFINITY
+// cookie, set on the first response and honored on subsequent requests. If
+// the pinned backend is dead, or no valid cookie is present, it falls back
+// to the underlying BalancingStrategy.
+type CookiePersistence struct {
+	secret   []byte
+	fallback BalancingStrategy
+}
+
+// NewCookiePersistence builds a cookie-based persistence mode, signing
+// cookies with secret and falling back to fallback when no sticky backend
+// can be used.
+func NewCookiePersistence(secret []byte, fallback BalancingStrategy) *CookiePersistence {
+	return &CookiePersistence{secret: secret, fallback: fallback}
+}
+
+// Pick honors a valid, alive LB_AFFINITY cookie; otherwise it defers to the
+// fallback strategy.
+func (c *CookiePersistence) Pick(r *http.Request, backends []*Backend) *Backend {
+	if cookie, err := r.Cookie(affinityCookieName); err == nil {
+		if id, ok := c.verify(cookie.Value); ok {
+			for _, b := range backends {
+				if b.URL.String() == id && b.Available() {
+					return b
+				}
+			}
+		}
+	}
+	return c.fallback.Pick(r, backends)
+}
+
+// Apply sets (or refreshes) the LB_AFFINITY cookie to pin future requests to
+// chosen.
+func (c *CookiePersistence) Apply(w http.ResponseWriter, r *http.Request, chosen *Backend) {
+	if chosen == nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:  affinityCookieName,
+		Value: c.sign(chosen.URL.String()),
+		Path:  "/",
+	})
+}
+
+// sign returns "<id>.<hmac>" for id, so verify can detect tampering.
+func (c *CookiePersistence) sign(id string) string {
+	return id + "." + hex.EncodeToString(c.mac(id))
+}
+
+// verify checks a signed cookie value produced by sign and returns the
+// backend id it names.
+func (c *CookiePersistence) verify(value string) (id string, ok bool) {
+	idx := strings.LastIndex(value, ".")
+	if idx == -1 {
+		return "", false
+	}
+	id, sig := value[:idx], value[idx+1:]
+	want, err := hex.DecodeString(sig)
+	if err != nil {
+		return "", false
+	}
+	if !hmac.Equal(want, c.mac(id)) {
+		return "", false
+	}
+	return id, true
+}
+
+func (c *CookiePersistence) mac(id string) []byte {
+	m := hmac.New(sha256.New, c.secret)
+	m.Write([]byte(id))
+	return m.Sum(nil)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func testPersistenceBackend(t *testing.T, rawurl string) *Backend {
+	t.Helper()
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", rawurl, err)
+	}
+	return &Backend{URL: u, Alive: true}
+}
+
+func TestSourceAddressAffinityPicksSameBackendForSameClientIP(t *testing.T) {
+	a := testPersistenceBackend(t, "http://a:8080")
+	b := testPersistenceBackend(t, "http://b:8080")
+	pool := newTestPool(t, a, b)
+
+	persistence := NewSourceAddressAffinity(pool, false)
+	backends := pool.Backends()
+
+	r1 := httptest.NewRequest(http.MethodGet, "/", nil)
+	r1.RemoteAddr = "10.0.0.1:4000"
+	r2 := httptest.NewRequest(http.MethodGet, "/", nil)
+	r2.RemoteAddr = "10.0.0.1:5555" // same IP, different port
+
+	first := persistence.Pick(r1, backends)
+	second := persistence.Pick(r2, backends)
+	if first == nil || second == nil || first != second {
+		t.Fatalf("Pick(%v) = %v, Pick(%v) = %v; want the same backend for the same client IP", r1.RemoteAddr, first, r2.RemoteAddr, second)
+	}
+}
+
+func TestSourceAddressAffinityFallsOverWhenPinnedBackendDies(t *testing.T) {
+	a := testPersistenceBackend(t, "http://a:8080")
+	b := testPersistenceBackend(t, "http://b:8080")
+	pool := newTestPool(t, a, b)
+
+	persistence := NewSourceAddressAffinity(pool, false)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:4000"
+
+	pinned := persistence.Pick(r, pool.Backends())
+	if pinned == nil {
+		t.Fatal("Pick returned nil with two alive backends")
+	}
+	pinned.SetAlive(false)
+
+	fallback := persistence.Pick(r, pool.Backends())
+	if fallback == nil {
+		t.Fatal("Pick returned nil after the pinned backend died, want the remaining alive backend")
+	}
+	if fallback == pinned {
+		t.Fatalf("Pick returned the dead backend %v", fallback.URL)
+	}
+}
+
+func TestCookiePersistenceHonorsValidCookie(t *testing.T) {
+	a := testPersistenceBackend(t, "http://a:8080")
+	b := testPersistenceBackend(t, "http://b:8080")
+	backends := []*Backend{a, b}
+
+	persistence := NewCookiePersistence([]byte("test-secret"), &RoundRobinStrategy{})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: affinityCookieName, Value: persistence.sign(b.URL.String())})
+
+	peer := persistence.Pick(r, backends)
+	if peer != b {
+		t.Fatalf("Pick returned %v, want the cookie-pinned backend %v", peer, b.URL)
+	}
+}
+
+func TestCookiePersistenceFallsBackWithoutCookie(t *testing.T) {
+	a := testPersistenceBackend(t, "http://a:8080")
+	backends := []*Backend{a}
+
+	persistence := NewCookiePersistence([]byte("test-secret"), &RoundRobinStrategy{})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	peer := persistence.Pick(r, backends)
+	if peer != a {
+		t.Fatalf("Pick returned %v without a cookie, want fallback strategy's choice %v", peer, a.URL)
+	}
+}
+
+func TestCookiePersistenceFallsBackOnTamperedCookie(t *testing.T) {
+	a := testPersistenceBackend(t, "http://a:8080")
+	b := testPersistenceBackend(t, "http://b:8080")
+	backends := []*Backend{a, b}
+
+	persistence := NewCookiePersistence([]byte("test-secret"), &RoundRobinStrategy{})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: affinityCookieName, Value: b.URL.String() + ".deadbeef"})
+
+	peer := persistence.Pick(r, backends)
+	if peer == nil {
+		t.Fatal("Pick returned nil on a tampered cookie, want fallback to the strategy")
+	}
+}
+
+func TestCookiePersistenceFallsBackWhenPinnedBackendDead(t *testing.T) {
+	a := testPersistenceBackend(t, "http://a:8080")
+	b := testPersistenceBackend(t, "http://b:8080")
+	b.Alive = false
+	backends := []*Backend{a, b}
+
+	persistence := NewCookiePersistence([]byte("test-secret"), &RoundRobinStrategy{})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: affinityCookieName, Value: persistence.sign(b.URL.String())})
+
+	peer := persistence.Pick(r, backends)
+	if peer != a {
+		t.Fatalf("Pick returned %v, want fallback to the alive backend %v since the pinned one is dead", peer, a.URL)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// BalancingStrategy selects which backend should serve a given request.
+// Implementations must be safe for concurrent use.
+type BalancingStrategy interface {
+	Pick(r *http.Request, backends []*Backend) *Backend
+}
+
+// RoundRobinStrategy cycles through alive backends in order.
+type RoundRobinStrategy struct {
+	current uint64 // atomic counter
+}
+
+// Pick returns the next alive backend in round-robin order.
+func (s *RoundRobinStrategy) Pick(r *http.Request, backends []*Backend) *Backend {
+	if len(backends) == 0 {
+		return nil
+	}
+	next := atomic.AddUint64(&s.current, 1)
+	l := len(backends)
+	for i := 0; i < l; i++ {
+		idx := int((next + uint64(i)) % uint64(l))
+		if backends[idx].Available() {
+			return backends[idx]
+		}
+	}
+	return nil
+}
+
+// WeightedRoundRobinStrategy implements smooth weighted round-robin: on each
+// pick every backend's current weight is increased by its configured weight,
+// the backend with the highest current weight is chosen, and that backend's
+// current weight is reduced by the total weight of all backends.
+type WeightedRoundRobinStrategy struct {
+	mu      sync.Mutex
+	current map[*Backend]int64
+}
+
+// NewWeightedRoundRobinStrategy returns a ready-to-use WRR strategy.
+func NewWeightedRoundRobinStrategy() *WeightedRoundRobinStrategy {
+	return &WeightedRoundRobinStrategy{current: make(map[*Backend]int64)}
+}
+
+// Pick returns the alive backend with the highest current weight, favoring
+// backends with a larger configured weight over time.
+func (s *WeightedRoundRobinStrategy) Pick(r *http.Request, backends []*Backend) *Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	present := make(map[*Backend]bool, len(backends))
+	var totalWeight int64
+	var best *Backend
+	for _, b := range backends {
+		present[b] = true
+		if !b.Available() {
+			continue
+		}
+		weight := b.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		totalWeight += weight
+		s.current[b] += weight
+		if best == nil || s.current[b] > s.current[best] {
+			best = b
+		}
+	}
+	if best != nil {
+		s.current[best] -= totalWeight
+	}
+	s.prune(present)
+	return best
+}
+
+// prune drops any entries for backends no longer present in the pool, so a
+// backend removed via the admin API (or a repeatedly flapping one) doesn't
+// leak its map entry for the life of the process.
+func (s *WeightedRoundRobinStrategy) prune(present map[*Backend]bool) {
+	for b := range s.current {
+		if !present[b] {
+			delete(s.current, b)
+		}
+	}
+}
+
+// LeastConnectionsStrategy picks the alive backend with the fewest active
+// connections, breaking ties with round-robin ordering.
+type LeastConnectionsStrategy struct {
+	current uint64 // atomic counter, used to break ties
+}
+
+// Pick returns the alive backend with the lowest active connection count.
+func (s *LeastConnectionsStrategy) Pick(r *http.Request, backends []*Backend) *Backend {
+	if len(backends) == 0 {
+		return nil
+	}
+	next := atomic.AddUint64(&s.current, 1)
+	l := len(backends)
+
+	var best *Backend
+	var bestConns int64
+	for i := 0; i < l; i++ {
+		idx := int((next + uint64(i)) % uint64(l))
+		b := backends[idx]
+		if !b.Available() {
+			continue
+		}
+		conns := b.GetActiveConnections()
+		if best == nil || conns < bestConns {
+			best = b
+			bestConns = conns
+		}
+	}
+	return best
+}
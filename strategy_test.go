@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+func testBackend(t *testing.T, rawurl string, weight int64) *Backend {
+	t.Helper()
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", rawurl, err)
+	}
+	return &Backend{URL: u, Weight: weight, Alive: true}
+}
+
+func TestRoundRobinStrategyDistributesEvenly(t *testing.T) {
+	backends := []*Backend{
+		testBackend(t, "http://a:8080", 1),
+		testBackend(t, "http://b:8080", 1),
+		testBackend(t, "http://c:8080", 1),
+	}
+	strategy := &RoundRobinStrategy{}
+
+	counts := make(map[string]int)
+	const total = 300
+	for i := 0; i < total; i++ {
+		peer := strategy.Pick(nil, backends)
+		if peer == nil {
+			t.Fatalf("Pick returned nil on iteration %d", i)
+		}
+		counts[peer.URL.String()]++
+	}
+
+	for _, b := range backends {
+		if got := counts[b.URL.String()]; got != total/len(backends) {
+			t.Errorf("backend %s got %d picks, want %d", b.URL, got, total/len(backends))
+		}
+	}
+}
+
+func TestRoundRobinStrategySkipsDeadBackends(t *testing.T) {
+	dead := testBackend(t, "http://a:8080", 1)
+	dead.Alive = false
+	alive := testBackend(t, "http://b:8080", 1)
+	backends := []*Backend{dead, alive}
+
+	strategy := &RoundRobinStrategy{}
+	for i := 0; i < 10; i++ {
+		peer := strategy.Pick(nil, backends)
+		if peer != alive {
+			t.Fatalf("Pick returned %v, want the only alive backend %v", peer, alive)
+		}
+	}
+}
+
+func TestWeightedRoundRobinStrategyDistributesByWeight(t *testing.T) {
+	heavy := testBackend(t, "http://a:8080", 3)
+	light := testBackend(t, "http://b:8080", 1)
+	backends := []*Backend{heavy, light}
+
+	strategy := NewWeightedRoundRobinStrategy()
+
+	counts := make(map[string]int)
+	const rounds = 100
+	for i := 0; i < rounds*4; i++ {
+		peer := strategy.Pick(nil, backends)
+		if peer == nil {
+			t.Fatalf("Pick returned nil on iteration %d", i)
+		}
+		counts[peer.URL.String()]++
+	}
+
+	wantHeavy := rounds * 3
+	wantLight := rounds
+	if counts[heavy.URL.String()] != wantHeavy {
+		t.Errorf("heavy backend got %d picks, want %d", counts[heavy.URL.String()], wantHeavy)
+	}
+	if counts[light.URL.String()] != wantLight {
+		t.Errorf("light backend got %d picks, want %d", counts[light.URL.String()], wantLight)
+	}
+}
+
+func TestWeightedRoundRobinStrategyPrunesRemovedBackends(t *testing.T) {
+	a := testBackend(t, "http://a:8080", 1)
+	b := testBackend(t, "http://b:8080", 1)
+
+	strategy := NewWeightedRoundRobinStrategy()
+	strategy.Pick(nil, []*Backend{a, b})
+	if len(strategy.current) != 2 {
+		t.Fatalf("current has %d entries after first Pick, want 2", len(strategy.current))
+	}
+
+	// b is removed from the pool; the next Pick should drop its stale entry.
+	strategy.Pick(nil, []*Backend{a})
+	if len(strategy.current) != 1 {
+		t.Fatalf("current has %d entries after b was removed, want 1", len(strategy.current))
+	}
+	if _, ok := strategy.current[b]; ok {
+		t.Fatalf("current still holds an entry for removed backend %v", b.URL)
+	}
+}
+
+func TestLeastConnectionsStrategyPrefersFewerActiveConns(t *testing.T) {
+	busy := testBackend(t, "http://a:8080", 1)
+	idle := testBackend(t, "http://b:8080", 1)
+	atomic.AddInt64(&busy.activeConns, 5)
+
+	strategy := &LeastConnectionsStrategy{}
+	for i := 0; i < 10; i++ {
+		peer := strategy.Pick(nil, []*Backend{busy, idle})
+		if peer != idle {
+			t.Fatalf("Pick returned %v, want the idle backend %v", peer, idle)
+		}
+	}
+}
+
+func TestLeastConnectionsStrategyBreaksTiesRoundRobin(t *testing.T) {
+	a := testBackend(t, "http://a:8080", 1)
+	b := testBackend(t, "http://b:8080", 1)
+	backends := []*Backend{a, b}
+
+	strategy := &LeastConnectionsStrategy{}
+	counts := make(map[string]int)
+	const total = 200
+	for i := 0; i < total; i++ {
+		peer := strategy.Pick(nil, backends)
+		counts[peer.URL.String()]++
+	}
+
+	for _, be := range backends {
+		if got := counts[be.URL.String()]; got != total/len(backends) {
+			t.Errorf("backend %s got %d picks, want %d", be.URL, got, total/len(backends))
+		}
+	}
+}